@@ -5,6 +5,7 @@ import (
 	"go-websocket/impl"
 	"net/http"
 	"time"
+	"timer"
 )
 
 var (
@@ -23,6 +24,8 @@ func wsHandler(w http.ResponseWriter,r *http.Request){
 		err error
 		data []byte
 		conn *impl.Connection
+		heartbeat *timer.ChanTicker
+		heartbeatDone chan struct{}
 	)
 	// Upgrade websocket
 	if wsConn,err = upgrader.Upgrade(w,r,nil); err != nil {
@@ -31,14 +34,19 @@ func wsHandler(w http.ResponseWriter,r *http.Request){
 	if conn,err = impl.InitConnection(wsConn);err != nil {
 		goto ERR
 	}
+	heartbeat = timer.NewTicker(1*time.Millisecond)
+	heartbeatDone = make(chan struct{})
 	go func() {
-		var(
-			err error
-		)
-		if err = conn.WriteMessage([]byte("heartbeat"));err!=nil{
-			return
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-heartbeat.C:
+				if err := conn.WriteMessage([]byte("heartbeat")); err != nil {
+					return
+				}
+			}
 		}
-		time.Sleep(1*time.Millisecond)
 	}()
 	// websocket Conn
 	for {
@@ -50,9 +58,16 @@ func wsHandler(w http.ResponseWriter,r *http.Request){
 		}
 	}
 ERR:
+	if heartbeat != nil {
+		heartbeat.Stop()
+		close(heartbeatDone)
+	}
 	conn.Close()
 }
 func main(){
+	// 启动定时器模块的驱动goroutine，wsHandler里的心跳ticker依赖它来触发
+	timer.StartTicks(1*time.Millisecond)
+
 	// http://localhost:7777/
 	http.HandleFunc("/ws",wsHandler)
 
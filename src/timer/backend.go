@@ -0,0 +1,45 @@
+package timer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"timer/wheel"
+)
+
+// Backend是timer包可以使用的调度后端
+type Backend int32
+
+const (
+	BackendHeap  Backend = iota // 默认后端：分片heap，见timer.go
+	BackendWheel                // 层级时间轮后端，见timer/wheel
+)
+
+const (
+	wheelTickMs = int64(MIN_TIMER_INTERVAL / time.Millisecond) // 时间轮最底层一个槽的跨度，和MIN_TIMER_INTERVAL保持一致
+	wheelSize   = 512                                          // 每一层的槽数量
+)
+
+var (
+	activeBackend  int32 = int32(BackendHeap)
+	wheelScheduler *wheel.Scheduler
+	wheelOnce      sync.Once
+)
+
+// Use选择AddCallback/AddTimer使用的调度后端。heap是默认值，行为和重构前完全一致；
+// BackendWheel下插入和取消都是O(1)的链表操作，更适合像websocket心跳这种连接进进出出
+// 非常频繁的场景。同一个进程里切换后端不会影响已经创建的Timer。
+func Use(b Backend) {
+	if b == BackendWheel {
+		wheelOnce.Do(func() {
+			wheelScheduler = wheel.NewScheduler(wheelTickMs, wheelSize)
+			wheelScheduler.Run()
+		})
+	}
+	atomic.StoreInt32(&activeBackend, int32(b))
+}
+
+func usingWheel() bool {
+	return Backend(atomic.LoadInt32(&activeBackend)) == BackendWheel
+}
@@ -0,0 +1,121 @@
+package timer
+
+import (
+	"time"
+)
+
+// Reset重新设置一个已经存在的Timer的触发时间，返回它在被Reset之前是否还处于active状态。
+//
+// 和标准库time.Timer.Reset一样，如果定时器在Reset之前已经触发过，调用方需要自己保证
+// 对应的channel（例如ChanTimer.C）里残留的旧值已经被读走，否则后续可能读到一个过期的时间戳；
+// 这里的实现并不会替调用方把channel排空。
+func (t *Timer) Reset(d time.Duration) bool {
+	if t.repeat && d < MIN_TIMER_INTERVAL {
+		d = MIN_TIMER_INTERVAL
+	}
+
+	if t.wheelEntry != nil {
+		wasActive := t.wheelEntry.IsActive()
+		t.wheelEntry.Cancel()
+		t.cancelled = false
+		callback := t.callback
+		if t.repeat {
+			t.wheelEntry = wheelScheduler.AddTimer(d, func() { runCallback(callback) })
+		} else {
+			t.wheelEntry = wheelScheduler.AddCallback(d, func() { runCallback(callback) })
+		}
+		return wasActive
+	}
+
+	s := t.shard
+	if s == nil {
+		// 正常情况下AddTimer/AddCallback总会设置shard，这里只是兜底
+		t.fireTime = time.Now().Add(d)
+		t.interval = d
+		t.cancelled = false
+		addTimerToShard(t)
+		return false
+	}
+
+	s.lock.Lock()
+	wasActive := !t.cancelled
+	if wasActive && t.timerIndex >= 0 {
+		s.heap.remove(t.timerIndex)
+	}
+	t.fireTime = time.Now().Add(d)
+	t.interval = d
+	t.cancelled = false
+	t.addseq = s.addSeq
+	s.addSeq++
+	s.heap.push(t)
+	s.wakeIfNewMinLocked(t)
+	s.lock.Unlock()
+
+	return wasActive
+}
+
+// AfterFunc在d时间之后调用f，f运行在一个新启动的goroutine里，而不是在驱动其它定时器的
+// goroutine上执行，所以一个很慢的f不会拖慢其它定时器的触发。
+func AfterFunc(d time.Duration, f func()) *Timer {
+	return AddCallback(d, func() {
+		go f()
+	})
+}
+
+// ChanTimer是对Timer的封装，提供和标准库time.Timer一样的channel风格用法
+type ChanTimer struct {
+	C <-chan time.Time // 定时器触发时会往这里写入触发时刻，容量为1
+
+	t *Timer
+}
+
+// NewTimer创建一个一次性的ChanTimer，d时间之后C上会收到一个值
+func NewTimer(d time.Duration) *ChanTimer {
+	c := make(chan time.Time, 1)
+	ct := &ChanTimer{C: c}
+	ct.t = AddCallback(d, func() {
+		select {
+		case c <- time.Now():
+		default: // C里还有一个未被消费的值（例如触发之后没有读走C就调用了Reset），丢弃这一次
+		}
+	})
+	return ct
+}
+
+// Stop阻止定时器触发，返回它在Stop之前是否还处于active状态，和time.Timer.Stop语义一致
+func (ct *ChanTimer) Stop() bool {
+	active := ct.t.IsActive()
+	ct.t.Cancel()
+	return active
+}
+
+// Reset让定时器在d时间之后重新触发一次，返回它在Reset之前是否还处于active状态
+func (ct *ChanTimer) Reset(d time.Duration) bool {
+	return ct.t.Reset(d)
+}
+
+// ChanTicker是对Timer的封装，提供和标准库time.Ticker一样的channel风格用法
+type ChanTicker struct {
+	C <-chan time.Time // 每次触发都会往这里写入触发时刻，容量为1
+
+	t *Timer
+}
+
+// NewTicker创建一个每隔d时间触发一次的ChanTicker，在调用Stop之前会一直重复触发；
+// 如果接收方处理得比触发频率慢，多余的tick会被直接丢弃，而不是阻塞驱动定时器的goroutine。
+func NewTicker(d time.Duration) *ChanTicker {
+	c := make(chan time.Time, 1)
+	ct := &ChanTicker{C: c}
+	ct.t = AddTimer(d, func() {
+		select {
+		case c <- time.Now():
+		default: // 接收方还没消费上一次的tick，丢弃这一次
+		}
+	})
+	return ct
+}
+
+// Stop停止这个ticker，停止之后C上不会再收到新的值
+func (ct *ChanTicker) Stop() {
+	ct.t.Cancel()
+}
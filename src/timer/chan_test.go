@@ -0,0 +1,120 @@
+package timer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestMain drives the heap backend for the whole test binary, since AddCallback/
+// AddTimer no longer start a driver goroutine on their own (see Run in timer.go) —
+// without this nothing in this file would ever actually fire.
+func TestMain(m *testing.M) {
+	Run(context.Background())
+	os.Exit(m.Run())
+}
+
+// TestChanTickerConcurrentFireAndStop races many goroutines that each create a
+// ChanTicker, receive a few ticks and then Stop it, to exercise NewTicker/Stop
+// against the shared shard heap under -race.
+func TestChanTickerConcurrentFireAndStop(t *testing.T) {
+	const goroutines = 16
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for i := 0; i < goroutines; i++ {
+		go func() {
+			defer wg.Done()
+			ticker := NewTicker(time.Millisecond)
+			defer ticker.Stop()
+
+			timeout := time.After(20 * time.Millisecond)
+			select {
+			case <-ticker.C:
+			case <-timeout:
+				t.Error("ticker never fired within timeout")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestChanTimerResetConcurrentWithFire races Reset against the timer's own firing,
+// matching the documented time.Timer.Reset caveat: Reset only has to be safe to call
+// concurrently, not guarantee which deadline eventually wins.
+func TestChanTimerResetConcurrentWithFire(t *testing.T) {
+	ct := NewTimer(time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			ct.Reset(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-ct.C:
+	case <-time.After(50 * time.Millisecond):
+		t.Error("timer never fired within timeout")
+	}
+	wg.Wait()
+}
+
+// TestTimerSelfResetFromCallbackDoesNotDuplicate makes sure resetting a repeating timer
+// from inside its own callback — the common "rearm myself with a new interval" pattern —
+// doesn't leave the same *Timer pushed into the shard heap twice: tickShard pops t for
+// the in-flight callback, Reset sees t.timerIndex == -1 and pushes a fresh entry, and
+// without a guard tickShard would then unconditionally push the same t again once the
+// callback returns, duplicating it and doubling (then tripling, ...) the fire rate.
+func TestTimerSelfResetFromCallbackDoesNotDuplicate(t *testing.T) {
+	var fires int32
+	var tm *Timer
+	var tmMu sync.Mutex // 回调在driver goroutine上读取tm，需要和下面的赋值同步
+	tmMu.Lock()
+	tm = AddTimer(2*time.Millisecond, func() {
+		atomic.AddInt32(&fires, 1)
+		tmMu.Lock()
+		self := tm
+		tmMu.Unlock()
+		self.Reset(2 * time.Millisecond)
+	})
+	tmMu.Unlock()
+	defer tm.Cancel()
+
+	time.Sleep(60 * time.Millisecond)
+
+	// ~30个周期，留出调度误差的余量；如果每个周期的self-Reset都在heap里留下一个重复entry，
+	// 触发次数会逐周期累加（1+2+3+...），远超出这个上限
+	if got := atomic.LoadInt32(&fires); got > 45 {
+		t.Fatalf("callback fired %d times in 60ms on a 2ms self-resetting timer — its *Timer is being duplicated in the heap", got)
+	}
+}
+
+// TestAfterFuncRunsOffTheDriverGoroutine checks that a slow AfterFunc callback runs on
+// its own goroutine rather than on whichever shard driver fired it.
+func TestAfterFuncRunsOffTheDriverGoroutine(t *testing.T) {
+	done := make(chan struct{})
+	AfterFunc(time.Millisecond, func() {
+		// 睡眠时间比下面等待independent的超时长，如果f跑在driver上，independent就会超时
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	})
+
+	// 另一个定时器应该能在AfterFunc的回调还在睡眠的时候正常触发，
+	// 证明它们没有共用同一个驱动goroutine。
+	independent := make(chan struct{})
+	AddCallback(2*time.Millisecond, func() { close(independent) })
+
+	select {
+	case <-independent:
+	case <-time.After(20 * time.Millisecond):
+		t.Fatal("independent timer was blocked by AfterFunc's slow callback")
+	}
+
+	<-done
+}
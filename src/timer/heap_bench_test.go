@@ -0,0 +1,82 @@
+package timer
+
+import (
+	"container/heap"
+	"testing"
+	"time"
+)
+
+// binaryHeap是重构前container/heap版本的二叉堆实现，这里只保留用来和4叉堆做基准对比
+
+type binaryHeapItem struct {
+	fireTime time.Time
+	addseq   uint
+}
+
+type binaryHeap []binaryHeapItem
+
+func (h binaryHeap) Len() int { return len(h) }
+
+func (h binaryHeap) Less(i, j int) bool {
+	t1, t2 := h[i].fireTime, h[j].fireTime
+	if t1.Before(t2) {
+		return true
+	}
+	if t1.After(t2) {
+		return false
+	}
+	return h[i].addseq < h[j].addseq
+}
+
+func (h binaryHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *binaryHeap) Push(x interface{}) {
+	*h = append(*h, x.(binaryHeapItem))
+}
+
+func (h *binaryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// benchQuaternaryInsertPop往4叉堆里插入n个定时器再把它们全部弹出
+func benchQuaternaryInsertPop(b *testing.B, n int) {
+	now := time.Now()
+	for i := 0; i < b.N; i++ {
+		var h _TimerHeap
+		for j := 0; j < n; j++ {
+			h.push(&Timer{fireTime: now.Add(time.Duration(j)), addseq: uint(j)})
+		}
+		for h.Len() > 0 {
+			h.pop()
+		}
+	}
+}
+
+// benchBinaryInsertPop是旧的container/heap二叉堆版本的对照组
+func benchBinaryInsertPop(b *testing.B, n int) {
+	now := time.Now()
+	for i := 0; i < b.N; i++ {
+		h := &binaryHeap{}
+		heap.Init(h)
+		for j := 0; j < n; j++ {
+			heap.Push(h, binaryHeapItem{fireTime: now.Add(time.Duration(j)), addseq: uint(j)})
+		}
+		for h.Len() > 0 {
+			heap.Pop(h)
+		}
+	}
+}
+
+func BenchmarkQuaternaryHeap1k(b *testing.B)   { benchQuaternaryInsertPop(b, 1000) }
+func BenchmarkQuaternaryHeap10k(b *testing.B)  { benchQuaternaryInsertPop(b, 10000) }
+func BenchmarkQuaternaryHeap100k(b *testing.B) { benchQuaternaryInsertPop(b, 100000) }
+func BenchmarkQuaternaryHeap1M(b *testing.B)   { benchQuaternaryInsertPop(b, 1000000) }
+
+func BenchmarkBinaryHeap1k(b *testing.B)   { benchBinaryInsertPop(b, 1000) }
+func BenchmarkBinaryHeap10k(b *testing.B)  { benchBinaryInsertPop(b, 10000) }
+func BenchmarkBinaryHeap100k(b *testing.B) { benchBinaryInsertPop(b, 100000) }
+func BenchmarkBinaryHeap1M(b *testing.B)   { benchBinaryInsertPop(b, 1000000) }
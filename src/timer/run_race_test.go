@@ -0,0 +1,52 @@
+package timer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRunConcurrentAddResetCancel calls Run again on top of the driver TestMain already
+// started (a no-op, see TestRunIsSingleShot) and hammers AddTimer/Reset/Cancel from many
+// goroutines concurrently, to exercise the wakeIfNewMinLocked signalling path under -race.
+func TestRunConcurrentAddResetCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	Run(ctx)
+	defer cancel()
+
+	const goroutines = 16
+	const perGoroutine = 50
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				tm := AddTimer(time.Millisecond, func() {})
+				tm.Reset(2 * time.Millisecond)
+				tm.Cancel()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestRunIsSingleShot makes sure a second call to Run is a no-op: it must not spin up
+// another set of driver goroutines, and cancelling the ctx passed to that second call
+// must not drain timers that belong to the process-wide driver TestMain already started
+// with its own (never-cancelled) context.
+func TestRunIsSingleShot(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	Run(ctx) // no-op: Run already ran once in TestMain
+
+	tm := AddTimer(time.Hour, func() {})
+	cancel()
+	time.Sleep(5 * time.Millisecond)
+
+	if !tm.IsActive() {
+		t.Fatal("a no-op second call to Run still drained an unrelated pending timer")
+	}
+	tm.Cancel()
+}
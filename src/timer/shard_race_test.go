@@ -0,0 +1,33 @@
+package timer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentAddAndCancelAcrossShards hammers AddCallback/AddTimer/Cancel from many
+// goroutines at once, so pickShard's P-id hashing and the per-shard heap/lock pairing
+// introduced by the sharding rewrite get exercised under -race.
+func TestConcurrentAddAndCancelAcrossShards(t *testing.T) {
+	const goroutines = 32
+	const perGoroutine = 200
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				tm := AddCallback(time.Millisecond, func() {})
+				if i%2 == 0 {
+					tm.Cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(5 * time.Millisecond)
+	Tick()
+}
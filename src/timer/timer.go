@@ -1,56 +1,104 @@
 package timer
 
 import (
-	"container/heap" // Golang提供的heap库
+	"context"
 	"fmt"
 	"os"
+	"runtime"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
+	_ "unsafe" // 供下面的go:linkname使用
+
+	"timer/wheel"
 )
 
+// runtime_procPin/runtime_procUnpin链接到runtime内部的procPin/procUnpin，
+// 用来获取调用者当前绑定的P的id，从而实现无锁的分片选择。
+// sync包内部也是用同样的手法（见sync/runtime.go）。
+
+//go:linkname runtime_procPin runtime.procPin
+func runtime_procPin() int
+
+//go:linkname runtime_procUnpin runtime.procUnpin
+func runtime_procUnpin()
+
 const (
 	MIN_TIMER_INTERVAL = 1 * time.Millisecond // 循环定时器的最小时间间隔
 )
 
-var (
-	nextAddSeq uint = 1 // 用于为每个定时器对象生成一个唯一的递增的序号
-)
-
 // 定时器对象
 type Timer struct {
-	fireTime  time.Time // 触发时间
-	interval  time.Duration // 时间间隔（用于循环定时器）
-	callback  CallbackFunc // 回调函数
-	repeat    bool // 是否循环
-	cancelled bool // 是否已经取消
-	addseq    uint // 序号
+	fireTime   time.Time     // 触发时间
+	interval   time.Duration // 时间间隔（用于循环定时器）
+	callback   CallbackFunc  // 回调函数
+	repeat     bool          // 是否循环
+	cancelled  bool          // 是否已经取消
+	addseq     uint          // 序号
+	shard      *timerShard   // 这个定时器所属的分片（heap后端）
+	timerIndex int           // 定时器当前在所属分片heap里的下标，-1表示不在heap里
+	wheelEntry *wheel.Entry  // 这个定时器在时间轮里对应的entry（wheel后端），heap后端下为nil
 }
 
 // 取消一个定时器，这个定时器将不会被触发
+//
+// 如果定时器还在heap里，Cancel会把它立刻从heap中摘除，而不是留下一个tombstone等下次Tick时才清理，
+// 这样频繁AddTimer/Cancel不会让heap越堆越大；wheel后端下摘除同样是O(1)的链表操作。
 func (t *Timer) Cancel() {
+	if t.wheelEntry != nil {
+		t.wheelEntry.Cancel()
+		t.cancelled = true
+		return
+	}
+
+	s := t.shard
+	if s == nil { // 还没有被加入任何分片，直接标记即可
+		t.cancelled = true
+		return
+	}
+
+	s.lock.Lock()
+	if !t.cancelled && t.timerIndex >= 0 {
+		s.heap.remove(t.timerIndex)
+	}
 	t.cancelled = true
+	s.lock.Unlock()
 }
 
 // 判断定时器是否已经取消
 func (t *Timer) IsActive() bool {
-	return !t.cancelled
+	if t.wheelEntry != nil {
+		return t.wheelEntry.IsActive()
+	}
+
+	s := t.shard
+	if s == nil { // 还没有被加入任何分片，直接读取即可
+		return !t.cancelled
+	}
+
+	s.lock.Lock()
+	active := !t.cancelled
+	s.lock.Unlock()
+	return active
 }
 
-// 使用一个heap管理所有的定时器
+// 每个node最多有4个孩子的最小堆，用触发时间(fireTime, addseq)做key
+//
+// 相比二叉堆，4叉堆的高度更矮，sift-down时虽然要比较4个孩子，但整体访问的内存更集中，
+// 在节点数较多时对CPU cache更友好。
 type _TimerHeap struct {
 	timers []*Timer
 }
 
-// Golang要求heap必须实现下面这些函数，这些函数的含义都是不言自明的
+const heapArity = 4 // 每个节点的孩子数量
 
 func (h *_TimerHeap) Len() int {
 	return len(h.timers)
 }
 
-// 使用触发时间和需要对定时器进行比较
-func (h *_TimerHeap) Less(i, j int) bool {
-	//log.Println(h.timers[i].fireTime, h.timers[j].fireTime)
+// 使用触发时间和加入顺序对两个定时器进行比较
+func (h *_TimerHeap) less(i, j int) bool {
 	t1, t2 := h.timers[i].fireTime, h.timers[j].fireTime
 	if t1.Before(t2) {
 		return true
@@ -63,33 +111,148 @@ func (h *_TimerHeap) Less(i, j int) bool {
 	return h.timers[i].addseq < h.timers[j].addseq
 }
 
-func (h *_TimerHeap) Swap(i, j int) {
-	var tmp *Timer
-	tmp = h.timers[i]
-	h.timers[i] = h.timers[j]
-	h.timers[j] = tmp
+func (h *_TimerHeap) swap(i, j int) {
+	h.timers[i], h.timers[j] = h.timers[j], h.timers[i]
+	h.timers[i].timerIndex = i
+	h.timers[j].timerIndex = j
+}
+
+// push把一个定时器加入heap，并把它sift-up到正确的位置
+func (h *_TimerHeap) push(t *Timer) {
+	t.timerIndex = len(h.timers)
+	h.timers = append(h.timers, t)
+	h.siftUp(t.timerIndex)
+}
+
+// pop取出并移除heap顶部（最快触发）的定时器
+func (h *_TimerHeap) pop() *Timer {
+	n := len(h.timers) - 1
+	h.swap(0, n)
+	t := h.timers[n]
+	h.timers[n] = nil
+	h.timers = h.timers[:n]
+	t.timerIndex = -1
+	if n > 0 {
+		h.siftDown(0)
+	}
+	return t
 }
 
-func (h *_TimerHeap) Push(x interface{}) {
-	h.timers = append(h.timers, x.(*Timer))
+// remove按下标移除任意一个定时器，用于Cancel时立刻回收空间
+func (h *_TimerHeap) remove(i int) {
+	n := len(h.timers) - 1
+	if n != i {
+		h.swap(i, n)
+		h.timers[n].timerIndex = -1
+		h.timers = h.timers[:n]
+		h.siftDown(i)
+		h.siftUp(i)
+	} else {
+		h.timers[n].timerIndex = -1
+		h.timers = h.timers[:n]
+	}
 }
 
-func (h *_TimerHeap) Pop() (ret interface{}) {
-	l := len(h.timers)
-	h.timers, ret = h.timers[:l-1], h.timers[l-1]
-	return
+func (h *_TimerHeap) siftUp(i int) {
+	for i > 0 {
+		parent := (i - 1) / heapArity
+		if !h.less(i, parent) {
+			break
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *_TimerHeap) siftDown(i int) {
+	n := len(h.timers)
+	for {
+		first := heapArity*i + 1
+		if first >= n {
+			break
+		}
+		smallest := first
+		for c, last := first+1, first+heapArity; c < last && c < n; c++ {
+			if h.less(c, smallest) {
+				smallest = c
+			}
+		}
+		if !h.less(smallest, i) {
+			break
+		}
+		h.swap(i, smallest)
+		i = smallest
+	}
 }
 
 // 定时器回调函数的类型定义
 type CallbackFunc func()
 
+// 一个分片，拥有自己独立的heap、锁和驱动goroutine，避免所有定时器共用一把锁
+type timerShard struct {
+	lock   sync.Mutex
+	heap   _TimerHeap
+	addSeq uint // 这个分片内部的递增序号，只需要在分片内部保持单调即可
+
+	// wake在有新的定时器成为这个分片的堆顶时被写入一次，用来提前唤醒Run里睡眠的驱动goroutine；
+	// 容量为1，即使没有人在等待也不会阻塞发送方
+	wake chan struct{}
+}
+
 var (
-	timerHeap     _TimerHeap // 定时器heap对象
-	timerHeapLock sync.Mutex // 一个全局的锁
+	shards []*timerShard // 固定大小的分片数组
+
+	// roundRobinCounter 用于在拿不到P id的情况下，以无锁的方式轮询选择分片
+	roundRobinCounter uint32
+
+	runOnce sync.Once // 保证Run只真正启动一次，见Run的注释
 )
 
 func init() {
-	heap.Init(&timerHeap) // 初始化定时器heap
+	n := runtime.GOMAXPROCS(0)
+	if n < 1 {
+		n = 1
+	}
+	// 分片数量固定为64个，作为内存占用和锁竞争之间的折中；
+	// 当GOMAXPROCS超过64时才继续增长，避免极端机器上退化成单片
+	shardCount := 64
+	if n > shardCount {
+		shardCount = n
+	}
+
+	shards = make([]*timerShard, shardCount)
+	for i := range shards {
+		shards[i] = &timerShard{wake: make(chan struct{}, 1)}
+	}
+}
+
+// wakeIfNewMinLocked在t刚被push进heap之后调用；只有t变成了新的堆顶（说明它比分片原来
+// 等待的下一次触发时间更早）才需要唤醒驱动goroutine重新计算应该睡多久。
+//
+// 调用方必须already持有s.lock——t.timerIndex会被同一把锁保护下的swap/siftUp/siftDown
+// 并发修改，在锁外读取它是不安全的。
+func (s *timerShard) wakeIfNewMinLocked(t *Timer) {
+	if t.timerIndex != 0 {
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default: // 已经有一个待处理的唤醒信号，不需要再发一次
+	}
+}
+
+// pickShard 为新创建的定时器选择一个分片。
+//
+// 优先使用调用者所在P的id做哈希，这样同一个P上连续创建的定时器大概率落在同一个分片，
+// 减少跨核的cache line争用；拿不到P id时退化为原子轮询计数器，保证选择过程始终无锁。
+func pickShard() *timerShard {
+	pid := runtime_procPin()
+	runtime_procUnpin()
+	if pid >= 0 {
+		return shards[uint(pid)%uint(len(shards))]
+	}
+	idx := atomic.AddUint32(&roundRobinCounter, 1)
+	return shards[idx%uint32(len(shards))]
 }
 
 // 设置一个一次性的回调，这个回调将在d时间后触发，并调用callback函数
@@ -100,12 +263,11 @@ func AddCallback(d time.Duration, callback CallbackFunc) *Timer {
 		callback: callback,
 		repeat:   false,
 	}
-	timerHeapLock.Lock() // 使用锁规避竞争条件
-	t.addseq = nextAddSeq
-	nextAddSeq += 1
-
-	heap.Push(&timerHeap, t)
-	timerHeapLock.Unlock()
+	if usingWheel() {
+		t.wheelEntry = wheelScheduler.AddCallback(d, func() { runCallback(callback) })
+		return t
+	}
+	addTimerToShard(t)
 	return t
 }
 
@@ -121,34 +283,54 @@ func AddTimer(d time.Duration, callback CallbackFunc) *Timer {
 		callback: callback,
 		repeat:   true, // 设置为循环定时器
 	}
-	timerHeapLock.Lock()
-	t.addseq = nextAddSeq // set addseq when locked
-	nextAddSeq += 1
-
-	heap.Push(&timerHeap, t)
-	timerHeapLock.Unlock()
+	if usingWheel() {
+		t.wheelEntry = wheelScheduler.AddTimer(d, func() { runCallback(callback) })
+		return t
+	}
+	addTimerToShard(t)
 	return t
 }
 
-// 对定时器模块进行一次Tick
+// addTimerToShard 把一个刚创建的Timer放进它所属的分片
+func addTimerToShard(t *Timer) {
+	s := pickShard()
+	t.shard = s
+
+	s.lock.Lock()
+	t.addseq = s.addSeq
+	s.addSeq++
+	s.heap.push(t)
+	s.wakeIfNewMinLocked(t)
+	s.lock.Unlock()
+}
+
+// 对定时器模块进行一次Tick，所有分片依次处理各自到期的定时器
 //
-// 一般上层模块需要在一个主线程的goroutine里按一定的时间间隔不停的调用Tick函数，从而确保timer能够按时触发，并且
-// 所有Timer的回调函数也在这个goroutine里运行。
+// 调用过Run（或StartTicks）之后不需要再调用Tick；没有调用Run时，上层模块需要在一个goroutine里
+// 按一定的时间间隔不停的调用Tick函数，从而确保timer能够按时触发。
+// 注意：分片之间没有共享状态，各分片的回调函数仍然运行在调用Tick的这个goroutine里。
 func Tick() {
 	now := time.Now()
-	timerHeapLock.Lock()
+	for _, s := range shards {
+		tickShard(s, now)
+	}
+}
+
+// tickShard 处理单个分片里所有已经到期的定时器
+func tickShard(s *timerShard, now time.Time) {
+	s.lock.Lock()
 
 	for {
-		if timerHeap.Len() <= 0 { // 没有任何定时器，立刻返回
+		if s.heap.Len() <= 0 { // 没有任何定时器，立刻返回
 			break
 		}
 
-		nextFireTime := timerHeap.timers[0].fireTime
+		nextFireTime := s.heap.timers[0].fireTime
 		if nextFireTime.After(now) { // 没有到时间的定时器，返回
 			break
 		}
 
-		t := heap.Pop(&timerHeap).(*Timer)
+		t := s.heap.pop()
 
 		if t.cancelled { // 忽略已经取消的定时器
 			continue
@@ -158,34 +340,116 @@ func Tick() {
 			t.cancelled = true
 		}
 		// 必须先解锁，然后再调用定时器的回调函数，否则可能导致死锁！！！
-			timerHeapLock.Unlock()
+		s.lock.Unlock()
 		runCallback(t.callback) // 运行回调函数并捕获panic
-		timerHeapLock.Lock()
+		s.lock.Lock()
 
-		if t.repeat { // 如果是循环timer就把Timer重新放回heap中
-			// add Timer back to heap
+		if t.repeat && !t.cancelled && t.timerIndex < 0 {
+			// 如果是循环timer就把Timer重新放回heap中；t.cancelled为true说明回调执行期间被Cancel了，
+			// t.timerIndex>=0说明回调执行期间一次并发的Reset已经把t重新push回了heap——不管哪种情况，
+			// 这里都不能再push一次，否则同一个*Timer会在heap.timers里出现两次
 			t.fireTime = t.fireTime.Add(t.interval)
 			if !t.fireTime.After(now) {
 				t.fireTime = now.Add(t.interval)
 			}
-			t.addseq = nextAddSeq
-			nextAddSeq += 1
-			heap.Push(&timerHeap, t)
+			t.addseq = s.addSeq
+			s.addSeq++
+			s.heap.push(t)
+			// 这里不需要调用wakeIfNewMinLocked：Tick/tickShard本身就是驱动goroutine在跑，
+			// 重新push之后会立刻在下面重新计算睡眠时间
 		}
 	}
-	timerHeapLock.Unlock()
+	s.lock.Unlock()
 }
 
-// 创建一个goroutine对定时器模块进行定时的Tick
-func StartTicks(tickInterval time.Duration) {
-	go selfTickRoutine(tickInterval)
+// Run启动一个一个分片一个的驱动goroutine，让整个timer模块变成自驱动：不再需要上层
+// 按固定间隔轮询，每个驱动goroutine会一直睡到它那个分片堆顶定时器的触发时间，
+// 新插入的定时器如果成为了新的堆顶，会通过timerShard.wake提前唤醒对应的driver。
+//
+// ctx被取消时，所有驱动goroutine退出，并把各自分片里还没有触发的定时器标记为取消。
+//
+// Run只会真正生效一次：shards是进程级别的共享状态，如果允许重复调用，后面的调用会
+// 再为每个分片多启动一组driver goroutine，而且它们的ctx被取消时drainShard会清空
+// 所有分片——包括第一次调用Run之后、由别的调用方添加、原本完全不相关的定时器。
+// 所以这里用runOnce保证只有第一次调用真正启动driver并持有它传入的ctx，
+// 之后的调用直接no-op；需要停掉整个timer模块时，必须取消第一次调用Run时传入的ctx。
+//
+// 注意：这里会无条件为所有分片启动driver，不管分片当时是否为空，没有按需启动——
+// driver是阻塞在channel recv上而不是轮询，空分片的driver代价很低。
+func Run(ctx context.Context) {
+	runOnce.Do(func() {
+		for _, s := range shards {
+			go runShardDriver(ctx, s)
+		}
+	})
 }
 
-func selfTickRoutine(tickInterval time.Duration) {
+func runShardDriver(ctx context.Context, s *timerShard) {
+	wakeTimer := time.NewTimer(time.Hour) // 占位值，下面第一轮循环就会被Reset成正确的等待时间
+	if !wakeTimer.Stop() {
+		<-wakeTimer.C
+	}
+	defer wakeTimer.Stop()
+
 	for {
-		time.Sleep(tickInterval)
-		Tick()
+		s.lock.Lock()
+		empty := s.heap.Len() == 0
+		var wait time.Duration
+		if !empty {
+			wait = time.Until(s.heap.timers[0].fireTime)
+			if wait < 0 {
+				wait = 0
+			}
+		}
+		s.lock.Unlock()
+
+		if empty {
+			// 分片里暂时没有定时器，睡到被wake或者ctx取消为止，不设置超时
+			select {
+			case <-ctx.Done():
+				drainShard(s)
+				return
+			case <-s.wake:
+			}
+			continue
+		}
+
+		wakeTimer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			wakeTimer.Stop()
+			drainShard(s)
+			return
+		case <-wakeTimer.C:
+			tickShard(s, time.Now())
+		case <-s.wake:
+			// 有更早触发的定时器插进来了，停掉当前的等待，回到循环开头重新计算
+			if !wakeTimer.Stop() {
+				<-wakeTimer.C
+			}
+		}
+	}
+}
+
+// drainShard把一个分片里所有还没触发的定时器标记为取消，并清空这个分片的heap
+func drainShard(s *timerShard) {
+	s.lock.Lock()
+	for _, t := range s.heap.timers {
+		t.cancelled = true
+		t.timerIndex = -1
 	}
+	s.heap.timers = nil
+	s.lock.Unlock()
+}
+
+// StartTicks启动定时器模块的驱动goroutine。
+//
+// Deprecated: 定时器模块现在通过Run(ctx)实现自驱动，每个分片只在堆顶定时器到期时才被唤醒，
+// 不再需要按固定间隔轮询。StartTicks保留下来只是为了兼容老代码，tickInterval参数被忽略，
+// 内部直接调用Run(context.Background())。
+func StartTicks(tickInterval time.Duration) {
+	_ = tickInterval
+	Run(context.Background())
 }
 
 // 运行定时器的回调函数，并捕获panic，将panic转化为错误输出
@@ -198,4 +462,4 @@ func runCallback(callback CallbackFunc) {
 		}
 	}()
 	callback()
-}
\ No newline at end of file
+}
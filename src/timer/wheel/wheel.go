@@ -0,0 +1,299 @@
+// Package wheel实现了一个类似Kafka的层级时间轮(Hierarchical Timing Wheel)，
+// 作为timer包里heap调度器的替代后端：插入和取消都是O(1)，适合连接数巨大、
+// 进进出出非常频繁的场景（例如websocket心跳）。
+package wheel
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Entry代表挂在时间轮上的一个定时任务
+//
+// Entry本身不带锁：它所在的槽（container/list.List）和它的cancelled/owner/elem字段
+// 都只能在持有所属Scheduler.mu的前提下读写，因为一个entry具体挂在哪一层哪个槽上
+// 会随着cascade不断变化，只有Scheduler这个层面才知道当前的归属。
+type Entry struct {
+	deadlineMs int64 // 到期时间，相对于Scheduler启动时刻的毫秒数
+	intervalMs int64 // 循环定时器的间隔，单位毫秒；一次性任务为0
+	repeat     bool
+	callback   func()
+
+	sched     *Scheduler
+	cancelled bool
+	elem      *list.Element // 当前所在槽里的链表节点，用于O(1)删除
+	owner     *list.List    // 当前所在的槽
+}
+
+// Cancel取消这个任务，如果任务还挂在某个槽上会立刻把它从链表里摘除
+func (e *Entry) Cancel() {
+	e.sched.mu.Lock()
+	defer e.sched.mu.Unlock()
+	e.cancelLocked()
+}
+
+// cancelLocked要求调用方已经持有e.sched.mu
+func (e *Entry) cancelLocked() {
+	if e.cancelled {
+		return
+	}
+	e.cancelled = true
+	if e.owner != nil && e.elem != nil {
+		e.owner.Remove(e.elem)
+		e.owner, e.elem = nil, nil
+	}
+}
+
+// IsActive判断任务是否还会被触发
+func (e *Entry) IsActive() bool {
+	e.sched.mu.Lock()
+	defer e.sched.mu.Unlock()
+	return !e.cancelled
+}
+
+// markFiredLocked在任务触发之后调用：一次性任务触发后即视为取消，循环任务保持有效；
+// 要求调用方已经持有e.sched.mu
+func (e *Entry) markFiredLocked() {
+	e.owner, e.elem = nil, nil
+	if !e.repeat {
+		e.cancelled = true
+	}
+}
+
+// 单层时间轮：wheelSize个槽，每个槽代表tickMs毫秒
+//
+// wheel自己不加锁，所有方法都要求调用方已经持有Scheduler.mu
+type wheel struct {
+	tickMs      int64
+	wheelSize   int64
+	spanMs      int64 // tickMs * wheelSize，即这一层能表示的最大时间跨度
+	currentTime int64 // 当前指针对应的时间（向下取整到tickMs的边界）
+	slots       []*list.List
+
+	overflow *wheel // 上一级溢出轮；delay超出spanMs时任务会先插入到这里
+}
+
+func newWheel(tickMs, wheelSize, startMs int64) *wheel {
+	slots := make([]*list.List, wheelSize)
+	for i := range slots {
+		slots[i] = list.New()
+	}
+	return &wheel{
+		tickMs:      tickMs,
+		wheelSize:   wheelSize,
+		spanMs:      tickMs * wheelSize,
+		currentTime: startMs - startMs%tickMs,
+		slots:       slots,
+	}
+}
+
+// add把任务放进这一层（或者向上逐层溢出），返回false表示任务已经到期，调用方需要立刻执行
+func (w *wheel) add(e *Entry) bool {
+	if e.deadlineMs < w.currentTime+w.tickMs {
+		return false // 已经到期（或者马上到期），不需要再放进轮子
+	}
+
+	if e.deadlineMs < w.currentTime+w.spanMs {
+		// 落在当前这一层范围内，直接挂进对应的槽
+		idx := (e.deadlineMs / w.tickMs) % w.wheelSize
+		slot := w.slots[idx]
+
+		e.owner = slot
+		e.elem = slot.PushBack(e)
+		return true
+	}
+
+	// 超出当前层能表示的范围，转交给上一级（tickMs更大）的溢出轮
+	if w.overflow == nil {
+		w.overflow = newWheel(w.spanMs, w.wheelSize, w.currentTime)
+	}
+	return w.overflow.add(e)
+}
+
+// advanceTo把指针推进到nowMs，沿途把到期的槽清空并cascade到下层，
+// 收集所有真正到期（不能再往下cascade）的任务，由调用方负责执行
+func (w *wheel) advanceTo(nowMs int64, expired *[]*Entry) {
+	if nowMs < w.currentTime+w.tickMs {
+		return
+	}
+
+	for w.currentTime+w.tickMs <= nowMs {
+		w.currentTime += w.tickMs
+		idx := (w.currentTime / w.tickMs) % w.wheelSize
+		slot := w.slots[idx]
+
+		var entries []*Entry
+		for el := slot.Front(); el != nil; el = el.Next() {
+			entries = append(entries, el.Value.(*Entry))
+		}
+		slot.Init() // 清空这个槽
+
+		for _, e := range entries {
+			cancelled := e.cancelled
+			e.owner, e.elem = nil, nil
+			if cancelled {
+				continue
+			}
+			// 这里不区分任务是否真正到期：从溢出轮cascade下来的任务deadline可能还没到，
+			// 由Scheduler.advance负责把它们重新放进精度更高的下一层
+			*expired = append(*expired, e)
+		}
+	}
+
+	if w.overflow != nil {
+		w.overflow.advanceTo(nowMs, expired)
+	}
+}
+
+// Scheduler是时间轮的对外入口，负责驱动所有层级的wheel并触发到期的回调
+//
+// mu是整个调度器唯一的锁：它同时保护wheel/slot结构和挂在上面的每个Entry的
+// cancelled/owner/elem字段，因为一个entry具体在哪个slot、或者有没有被cancel，
+// 都只有在持锁的情况下才能安全地跨goroutine观察和修改。
+type Scheduler struct {
+	mu        sync.Mutex
+	base      *wheel
+	startedAt time.Time
+
+	stop chan struct{}
+}
+
+// NewScheduler创建一个时间轮调度器：tickMs是最底层一个槽代表的毫秒数，wheelSize是每层的槽数量
+func NewScheduler(tickMs int64, wheelSize int64) *Scheduler {
+	if tickMs < 1 {
+		tickMs = 1
+	}
+	if wheelSize < 1 {
+		wheelSize = 1
+	}
+	return &Scheduler{
+		base:      newWheel(tickMs, wheelSize, 0),
+		startedAt: time.Now(),
+		stop:      make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) nowMs() int64 {
+	return int64(time.Since(s.startedAt) / time.Millisecond)
+}
+
+// AddCallback注册一个一次性任务，d时间之后触发一次callback
+func (s *Scheduler) AddCallback(d time.Duration, callback func()) *Entry {
+	return s.schedule(d, 0, false, callback)
+}
+
+// AddTimer注册一个循环任务，第一次在d时间之后触发，以后每隔d时间重复触发
+func (s *Scheduler) AddTimer(d time.Duration, callback func()) *Entry {
+	return s.schedule(d, d, true, callback)
+}
+
+func (s *Scheduler) schedule(d, interval time.Duration, repeat bool, callback func()) *Entry {
+	e := &Entry{
+		sched:      s,
+		deadlineMs: s.nowMs() + d.Milliseconds(),
+		intervalMs: interval.Milliseconds(),
+		repeat:     repeat,
+		callback:   callback,
+	}
+
+	s.mu.Lock()
+	if !s.base.add(e) {
+		// 延时小于一个tick，直接当作立刻到期，留给下一次advance时触发
+		e.deadlineMs = s.base.currentTime + s.base.tickMs
+		s.base.add(e)
+	}
+	s.mu.Unlock()
+	return e
+}
+
+// Run启动一个每tickMs执行一次的后台goroutine来推进时间轮，直到Stop被调用
+func (s *Scheduler) Run() {
+	go s.loop()
+}
+
+// Stop停止时间轮的推进goroutine
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) loop() {
+	ticker := time.NewTicker(time.Duration(s.base.tickMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.advance()
+		}
+	}
+}
+
+func (s *Scheduler) advance() {
+	now := s.nowMs()
+
+	for {
+		var expired []*Entry
+		s.mu.Lock()
+		s.base.advanceTo(now, &expired)
+		s.mu.Unlock()
+
+		if len(expired) == 0 {
+			return
+		}
+
+		for _, e := range expired {
+			s.mu.Lock()
+			if e.cancelled { // 两次加锁之间可能被Cancel了，不能再触发回调或重新挂回
+				s.mu.Unlock()
+				continue
+			}
+			if e.deadlineMs > now {
+				// 还没真正到期，说明是从溢出轮cascade下来的，重新挂回合适的层级
+				if !s.base.add(e) {
+					// 不到一个tick就到期，和schedule一样留给下一次advance触发
+					e.deadlineMs = s.base.currentTime + s.base.tickMs
+					s.base.add(e)
+				}
+				s.mu.Unlock()
+				continue
+			}
+			e.markFiredLocked()
+			s.mu.Unlock()
+
+			// 回调必须在不持锁的情况下运行，否则回调里调用Cancel/Reset会死锁
+			runSafely(e.callback)
+
+			if !e.repeat {
+				continue
+			}
+
+			s.mu.Lock()
+			if !e.cancelled { // 回调执行期间可能被其它goroutine取消了
+				e.deadlineMs = now + e.intervalMs
+				if !s.base.add(e) {
+					e.deadlineMs = s.base.currentTime + s.base.tickMs
+					s.base.add(e)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// runSafely运行回调函数，并捕获panic，将panic转化为错误输出，和timer包的runCallback保持一致
+func runSafely(callback func()) {
+	defer func() {
+		err := recover()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Timer callback paniced: %v\n", err)
+			debug.PrintStack()
+		}
+	}()
+	callback()
+}
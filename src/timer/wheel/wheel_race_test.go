@@ -0,0 +1,54 @@
+package wheel
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentAddCancelUnderRun drives the scheduler's background loop while many
+// goroutines concurrently add and cancel entries, so Cancel/add/advanceTo all touching
+// the same container/list.List under Scheduler.mu gets exercised under -race.
+func TestConcurrentAddCancelUnderRun(t *testing.T) {
+	s := NewScheduler(1, 64)
+	s.Run()
+	defer s.Stop()
+
+	const goroutines = 16
+	const perGoroutine = 100
+
+	var wg sync.WaitGroup
+	wg.Add(goroutines)
+	for g := 0; g < goroutines; g++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				e := s.AddCallback(time.Millisecond, func() {})
+				if i%3 == 0 {
+					e.Cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(20 * time.Millisecond)
+}
+
+// TestCancelSurvivesRepeatingReschedule re-arms a repeating entry while racing
+// Cancel against it, making sure a cancel that lands mid-fire doesn't get overwritten
+// by the reschedule in Scheduler.advance.
+func TestCancelSurvivesRepeatingReschedule(t *testing.T) {
+	s := NewScheduler(1, 64)
+	s.Run()
+	defer s.Stop()
+
+	e := s.AddTimer(time.Millisecond, func() {})
+	time.Sleep(5 * time.Millisecond)
+	e.Cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	if e.IsActive() {
+		t.Fatal("entry is still active after Cancel")
+	}
+}